@@ -0,0 +1,58 @@
+package load
+
+import "testing"
+
+func TestRoundUpBatchSize(t *testing.T) {
+	cases := []struct {
+		in   int
+		want int
+	}{
+		{in: 1, want: 1},
+		{in: 2, want: 2},
+		{in: 3, want: 5},
+		{in: 5, want: 5},
+		{in: 7, want: 10},
+		{in: 10, want: 10},
+		{in: 11, want: 20},
+		{in: 450, want: 500},
+		{in: 999, want: 1000},
+	}
+	for _, c := range cases {
+		if got := roundUpBatchSize(c.in); got != c.want {
+			t.Errorf("roundUpBatchSize(%d) = %d, want %d", c.in, got, c.want)
+		}
+	}
+}
+
+func TestAdjustedBatchSizeNoChangeWithinBand(t *testing.T) {
+	mid := (batchLatencyLow + batchLatencyHigh) / 2
+	if got := adjustedBatchSize(1000, mid); got != 1000 {
+		t.Errorf("adjustedBatchSize(1000, mid-band) = %d, want 1000 (unchanged)", got)
+	}
+}
+
+func TestAdjustedBatchSizeGrowsWhenFast(t *testing.T) {
+	got := adjustedBatchSize(1000, batchLatencyLow/2)
+	if got <= 1000 {
+		t.Errorf("adjustedBatchSize(1000, below-band latency) = %d, want > 1000", got)
+	}
+}
+
+func TestAdjustedBatchSizeShrinksWhenSlow(t *testing.T) {
+	got := adjustedBatchSize(1000, batchLatencyHigh*2)
+	if got >= 1000 {
+		t.Errorf("adjustedBatchSize(1000, above-band latency) = %d, want < 1000", got)
+	}
+}
+
+func TestAdjustedBatchSizeZeroLatencyUnchanged(t *testing.T) {
+	if got := adjustedBatchSize(1000, 0); got != 1000 {
+		t.Errorf("adjustedBatchSize(1000, 0) = %d, want 1000 (no sample yet)", got)
+	}
+}
+
+func TestAdjustedBatchSizeNeverBelowOne(t *testing.T) {
+	if got := adjustedBatchSize(1, batchLatencyHigh*1000); got < 1 {
+		t.Errorf("adjustedBatchSize(1, huge latency) = %d, want >= 1", got)
+	}
+}
@@ -0,0 +1,38 @@
+package load
+
+// duplexChannel connects a scanner goroutine to a group of workers sharing
+// a single partition: Batches flow from the scanner to the workers over
+// toWorker, and each worker signals completion of one Batch back to the
+// scanner over toScanner so the scanner can track in-flight work.
+type duplexChannel struct {
+	toWorker  chan Batch
+	toScanner chan bool
+}
+
+// newDuplexChannel returns a duplexChannel sized to allow queueLen Batches
+// to be in flight between the scanner and its workers before either side
+// blocks.
+func newDuplexChannel(queueLen int) *duplexChannel {
+	return &duplexChannel{
+		toWorker:  make(chan Batch, queueLen),
+		toScanner: make(chan bool, queueLen),
+	}
+}
+
+// sendToWorker hands a completed Batch off to whichever worker reads it
+// next.
+func (dc *duplexChannel) sendToWorker(b Batch) {
+	dc.toWorker <- b
+}
+
+// sendToScanner signals the scanner that a Batch previously sent to a
+// worker has finished processing.
+func (dc *duplexChannel) sendToScanner() {
+	dc.toScanner <- true
+}
+
+// close tells the workers reading toWorker that no further Batches are
+// coming, so they can drain and exit.
+func (dc *duplexChannel) close() {
+	close(dc.toWorker)
+}
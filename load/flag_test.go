@@ -0,0 +1,86 @@
+package load
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestDurationOrCountFlagSet(t *testing.T) {
+	cases := []struct {
+		in      string
+		wantD   time.Duration
+		wantN   int64
+		wantErr bool
+	}{
+		{in: "30s", wantD: 30 * time.Second},
+		{in: "5m", wantD: 5 * time.Minute},
+		{in: "1000000x", wantN: 1000000},
+		{in: "1x", wantN: 1},
+		{in: "0x", wantErr: true},
+		{in: "-5x", wantErr: true},
+		{in: "notaduration", wantErr: true},
+		{in: "0s", wantErr: true},
+		{in: "-1s", wantErr: true},
+	}
+	for _, c := range cases {
+		var f durationOrCountFlag
+		err := f.Set(c.in)
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("Set(%q): expected error, got nil", c.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Set(%q): unexpected error: %v", c.in, err)
+			continue
+		}
+		if f.d != c.wantD || f.n != c.wantN {
+			t.Errorf("Set(%q) = {d:%v n:%d}, want {d:%v n:%d}", c.in, f.d, f.n, c.wantD, c.wantN)
+		}
+	}
+}
+
+func TestDurationOrCountFlagSetResetsOtherField(t *testing.T) {
+	var f durationOrCountFlag
+	if err := f.Set("1000x"); err != nil {
+		t.Fatalf("Set(1000x): %v", err)
+	}
+	if err := f.Set("10s"); err != nil {
+		t.Fatalf("Set(10s): %v", err)
+	}
+	if f.n != 0 {
+		t.Errorf("n = %d, want 0 after switching to duration form", f.n)
+	}
+	if f.d != 10*time.Second {
+		t.Errorf("d = %v, want 10s", f.d)
+	}
+}
+
+func TestCoefficientOfVariation(t *testing.T) {
+	if _, ok := coefficientOfVariation(nil); ok {
+		t.Error("expected ok=false for empty samples")
+	}
+	if _, ok := coefficientOfVariation([]float64{0, 0, 0}); ok {
+		t.Error("expected ok=false for zero mean")
+	}
+
+	cv, ok := coefficientOfVariation([]float64{10, 10, 10})
+	if !ok {
+		t.Fatal("expected ok=true")
+	}
+	if cv != 0 {
+		t.Errorf("cv = %v, want 0 for identical samples", cv)
+	}
+
+	cv, ok = coefficientOfVariation([]float64{8, 10, 12})
+	if !ok {
+		t.Fatal("expected ok=true")
+	}
+	// mean=10, variance=((-2)^2+0^2+2^2)/3=8/3, stddev=sqrt(8/3)
+	want := math.Sqrt(8.0/3.0) / 10
+	if math.Abs(cv-want) > 1e-9 {
+		t.Errorf("cv = %v, want %v", cv, want)
+	}
+}
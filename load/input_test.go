@@ -0,0 +1,70 @@
+package load
+
+import "testing"
+
+func TestScanBudgetTakeUnlimited(t *testing.T) {
+	b := newScanBudget(-1)
+	if got := b.take(100); got != 100 {
+		t.Errorf("take(100) = %d, want 100 (unlimited)", got)
+	}
+	if got := b.take(1_000_000); got != 1_000_000 {
+		t.Errorf("take(1_000_000) = %d, want 1_000_000 (unlimited)", got)
+	}
+}
+
+func TestScanBudgetTakeLimited(t *testing.T) {
+	b := newScanBudget(10)
+	if got := b.take(6); got != 6 {
+		t.Errorf("take(6) = %d, want 6", got)
+	}
+	if got := b.take(6); got != 4 {
+		t.Errorf("take(6) = %d, want 4 (only 4 remaining)", got)
+	}
+	if got := b.take(1); got != 0 {
+		t.Errorf("take(1) = %d, want 0 (budget exhausted)", got)
+	}
+}
+
+func TestScanBudgetTakeSharedAcrossCallers(t *testing.T) {
+	b := newScanBudget(5)
+	var total int64
+	for i := 0; i < 10; i++ {
+		total += b.take(1)
+	}
+	if total != 5 {
+		t.Errorf("total taken = %d, want 5", total)
+	}
+}
+
+func TestIsGzipMagic(t *testing.T) {
+	if !isGzipMagic([]byte{0x1f, 0x8b, 0x08}) {
+		t.Error("expected gzip magic to match")
+	}
+	if isGzipMagic([]byte{0x1f}) {
+		t.Error("expected short input not to match")
+	}
+	if isGzipMagic([]byte{0x00, 0x00}) {
+		t.Error("expected non-gzip input not to match")
+	}
+}
+
+func TestIsZstdMagic(t *testing.T) {
+	if !isZstdMagic([]byte{0x28, 0xb5, 0x2f, 0xfd, 0x00}) {
+		t.Error("expected zstd magic to match")
+	}
+	if isZstdMagic([]byte{0x28, 0xb5, 0x2f}) {
+		t.Error("expected short input not to match")
+	}
+}
+
+func TestIsBzip2Magic(t *testing.T) {
+	if !isBzip2Magic([]byte("BZh9")) {
+		t.Error("expected bzip2 magic to match")
+	}
+	if isBzip2Magic([]byte("BZ")) {
+		t.Error("expected short input not to match")
+	}
+	if isBzip2Magic([]byte("gzh9")) {
+		t.Error("expected non-bzip2 input not to match")
+	}
+}
@@ -2,13 +2,30 @@ package load
 
 import (
 	"bufio"
+	"compress/bzip2"
+	"compress/gzip"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"math"
+	"math/rand"
+	"net/http"
+	_ "net/http/pprof"
 	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"golang.org/x/exp/mmap"
 )
 
 const (
@@ -20,8 +37,400 @@ const (
 	WorkerPerQueue = 0
 	// SingleQueue is the value to have only a single shared queue of work for all workers
 	SingleQueue = 1
+
+	// steadyStateThreshold is the coefficient of variation (stddev/mean) below
+	// which the trailing reporting-period rates are considered to have
+	// converged on a steady state.
+	steadyStateThreshold = 0.02
+
+	// adaptiveInitialBatchSize is the starting batch size for adaptive
+	// batching (-batch-size=auto / -adaptive-batching), chosen to be small
+	// enough to measure ProcessBatch latency quickly against any target.
+	adaptiveInitialBatchSize = 500
+	// batchLatencyLow and batchLatencyHigh bound the target band that
+	// adaptive batching tries to keep median per-batch ProcessBatch wall
+	// time within.
+	batchLatencyLow  = 50 * time.Millisecond
+	batchLatencyHigh = 200 * time.Millisecond
+	// maxBatchSizeGrowth caps how much a single adjustment may grow or
+	// shrink the batch size, to avoid oscillation.
+	maxBatchSizeGrowth = 100
+	// adaptiveBatchSizeDefaultPeriod is the adjustment period adjustBatchSize
+	// falls back to when -reporting-period is 0, since time.NewTicker
+	// requires a positive duration.
+	adaptiveBatchSizeDefaultPeriod = time.Second
+)
+
+// durationOrCountFlag is a flag.Value that accepts either a time.Duration
+// (e.g. "30s", "5m") or an iteration count expressed as "<N>x" (e.g.
+// "1000000x"), mirroring the semantics of the testing package's -benchtime
+// flag.
+type durationOrCountFlag struct {
+	d time.Duration
+	n int64
+}
+
+func (f *durationOrCountFlag) String() string {
+	if f.n > 0 {
+		return fmt.Sprintf("%dx", f.n)
+	}
+	return f.d.String()
+}
+
+func (f *durationOrCountFlag) Set(s string) error {
+	if strings.HasSuffix(s, "x") {
+		n, err := strconv.ParseInt(s[:len(s)-1], 10, 64)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("invalid count %q, must be of the form <N>x", s)
+		}
+		f.n, f.d = n, 0
+		return nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return fmt.Errorf("invalid duration %q", s)
+	}
+	f.d, f.n = d, 0
+	return nil
+}
+
+// stringSliceFlag is a flag.Value that collects repeated occurrences of a
+// flag (e.g. -file a.dat -file b.dat) into a slice.
+type stringSliceFlag []string
+
+func (f *stringSliceFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stringSliceFlag) Set(s string) error {
+	*f = append(*f, s)
+	return nil
+}
+
+// batchSizeFlag is the flag.Value for -batch-size: a positive integer, or
+// the literal "auto" to enable adaptive batch sizing (equivalent to
+// -adaptive-batching).
+type batchSizeFlag struct {
+	n    int
+	auto bool
+}
+
+func (f *batchSizeFlag) String() string {
+	if f.auto {
+		return "auto"
+	}
+	return strconv.Itoa(f.n)
+}
+
+func (f *batchSizeFlag) Set(s string) error {
+	if s == "auto" {
+		f.auto, f.n = true, adaptiveInitialBatchSize
+		return nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n <= 0 {
+		return fmt.Errorf("invalid batch size %q, must be a positive integer or \"auto\"", s)
+	}
+	f.n, f.auto = n, false
+	return nil
+}
+
+// batchSizeProvider supplies the current target batch size to the scanner.
+// With fixed batching it always returns the same value; with adaptive
+// batching (-batch-size=auto / -adaptive-batching) it is retargeted by
+// adjustBatchSize based on observed ProcessBatch latency.
+type batchSizeProvider struct {
+	n int64
+}
+
+func newBatchSizeProvider(initial int) *batchSizeProvider {
+	return &batchSizeProvider{n: int64(initial)}
+}
+
+// Get returns the current target batch size.
+func (p *batchSizeProvider) Get() int {
+	return int(atomic.LoadInt64(&p.n))
+}
+
+func (p *batchSizeProvider) set(n int) {
+	atomic.StoreInt64(&p.n, int64(n))
+}
+
+// roundDown10 rounds n down to the nearest power of 10 (roundDown10(0) == 1).
+func roundDown10(n int) int {
+	base := 1
+	for n >= 10 {
+		n /= 10
+		base *= 10
+	}
+	return base
+}
+
+// roundUpBatchSize rounds n up to the nearest value of the form
+// [1, 2, 5] * 10^k, the same heuristic testing.B uses to estimate N, chosen
+// to avoid a batch size that oscillates between adjustments.
+func roundUpBatchSize(n int) int {
+	base := roundDown10(n)
+	switch {
+	case n <= base:
+		return base
+	case n <= 2*base:
+		return 2 * base
+	case n <= 5*base:
+		return 5 * base
+	default:
+		return 10 * base
+	}
+}
+
+// adjustedBatchSize retargets current based on the median observed
+// ProcessBatch latency, growing or shrinking it toward
+// [batchLatencyLow, batchLatencyHigh] by the ratio of the nearer band edge to
+// that latency, capped at maxBatchSizeGrowth per adjustment. The result is
+// rounded up by roundUpBatchSize, so a shrink smaller than one 1/2/5 step
+// (e.g. 1000 at 300ms scales to 666, which rounds back up to 1000) leaves
+// the batch size unchanged and the latency above the band.
+func adjustedBatchSize(current int, medianLatency time.Duration) int {
+	var scale float64
+	switch {
+	case medianLatency <= 0:
+		return current
+	case medianLatency < batchLatencyLow:
+		scale = float64(batchLatencyLow) / float64(medianLatency)
+	case medianLatency > batchLatencyHigh:
+		scale = float64(batchLatencyHigh) / float64(medianLatency)
+	default:
+		return current
+	}
+	if scale > maxBatchSizeGrowth {
+		scale = maxBatchSizeGrowth
+	} else if scale < 1.0/maxBatchSizeGrowth {
+		scale = 1.0 / maxBatchSizeGrowth
+	}
+	target := int(float64(current) * scale)
+	if target < 1 {
+		target = 1
+	}
+	return roundUpBatchSize(target)
+}
+
+// terminationReason records why RunBenchmark stopped scanning input, so the
+// summary can tell the user whether it hit -limit, the -runtime deadline,
+// converged via -steady-state-window, or simply ran out of input with none
+// of those configured.
+type terminationReason int
+
+const (
+	terminationInputExhausted terminationReason = iota
+	terminationLimit
+	terminationDeadline
+	terminationSteadyState
+)
+
+func (r terminationReason) String() string {
+	switch r {
+	case terminationLimit:
+		return "limit"
+	case terminationDeadline:
+		return "runtime deadline"
+	case terminationSteadyState:
+		return "steady-state convergence"
+	default:
+		return "input exhausted"
+	}
+}
+
+// resultFormat selects how RunBenchmark renders its results: "text"
+// (human-readable, the default), "json" (a structured record per reporting
+// period plus a final summary object), or "go-bench" (a single line
+// compatible with testing.BenchmarkResult.String() and benchstat).
+const (
+	resultFormatText    = "text"
+	resultFormatJSON    = "json"
+	resultFormatGoBench = "go-bench"
+)
+
+// periodRecord is one reporting-period sample, emitted as a JSON line when
+// -result-format=json and retained for the final summary's percentiles.
+type periodRecord struct {
+	Time              int64   `json:"time"`
+	MetricRate        float64 `json:"metric_rate"`
+	MetricTotal       uint64  `json:"metric_total"`
+	OverallMetricRate float64 `json:"overall_metric_rate"`
+	RowRate           float64 `json:"row_rate,omitempty"`
+	RowTotal          uint64  `json:"row_total,omitempty"`
+	OverallRowRate    float64 `json:"overall_row_rate,omitempty"`
+	QueueDelayMs      float64 `json:"queue_delay_ms,omitempty"`
+	BatchSize         int     `json:"batch_size,omitempty"`
+}
+
+// memStatsDelta is a subset of runtime.MemStats captured around
+// RunBenchmark when -benchmem is set. AllocBytes is the heap in use at the
+// end of the run; the other fields are differences between the end and the
+// start of the run.
+type memStatsDelta struct {
+	AllocBytes      uint64 `json:"alloc_bytes"`
+	TotalAllocBytes uint64 `json:"total_alloc_bytes"`
+	Mallocs         uint64 `json:"mallocs"`
+	Frees           uint64 `json:"frees"`
+	NumGC           uint32 `json:"num_gc"`
+}
+
+// resultSummary is the final record written by -result-format=json and the
+// basis for the -result-format=go-bench line.
+type resultSummary struct {
+	DBName       string         `json:"db_name"`
+	Workers      uint           `json:"workers"`
+	BatchSize    int            `json:"batch_size"`
+	MetricCount  uint64         `json:"metric_count"`
+	RowCount     uint64         `json:"row_count,omitempty"`
+	TookSeconds  float64        `json:"took_seconds"`
+	MetricRate   float64        `json:"metric_rate"`
+	RowRate      float64        `json:"row_rate,omitempty"`
+	RateP50      float64        `json:"metric_rate_p50"`
+	RateP95      float64        `json:"metric_rate_p95"`
+	RateP99      float64        `json:"metric_rate_p99"`
+	TerminatedBy string         `json:"terminated_by"`
+	QueueDelayMs float64        `json:"mean_queue_delay_ms,omitempty"`
+	Periods      []periodRecord `json:"periods,omitempty"`
+	MemStats     *memStatsDelta `json:"mem_stats,omitempty"`
+}
+
+// percentile returns the p-th percentile (0 <= p <= 1) of sorted, which must
+// already be sorted in ascending order.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	idx := int(p * float64(len(sorted)-1))
+	return sorted[idx]
+}
+
+// goBenchLine renders res as a line compatible with
+// testing.BenchmarkResult.String() / benchstat, e.g.:
+//
+//	BenchmarkLoad/benchmark-4   1234567   810 ns/op   1234567.89 metrics/sec   123456.78 rows/sec   4096 B/op   12 allocs/op
+func goBenchLine(res resultSummary) string {
+	nsPerOp := res.TookSeconds * 1e9 / float64(res.MetricCount)
+	line := fmt.Sprintf("BenchmarkLoad/%s-%d\t%d\t%0.0f ns/op\t%0.2f metrics/sec\t%0.2f rows/sec",
+		res.DBName, res.Workers, res.MetricCount, nsPerOp, res.MetricRate, res.RowRate)
+	if res.MemStats != nil {
+		bytesPerOp := float64(res.MemStats.TotalAllocBytes) / float64(res.MetricCount)
+		allocsPerOp := float64(res.MemStats.Mallocs) / float64(res.MetricCount)
+		line += fmt.Sprintf("\t%0.0f B/op\t%0.0f allocs/op", bytesPerOp, allocsPerOp)
+	}
+	return line
+}
+
+// rate-distribution values for -rate-distribution, selecting how
+// rateLimiter schedules batch releases under an open-loop -target-rate.
+const (
+	rateDistributionConstant = "constant"
+	rateDistributionPoisson  = "poisson"
+	rateDistributionStep     = "step"
+	rateDistributionRamp     = "ramp"
 )
 
+// rateLimiter paces batch releases to a wall-clock schedule instead of the
+// default closed-loop behavior of releasing them as fast as workers drain
+// them. Wait blocks the scanner until a batch's scheduled time arrives and
+// reports the queueing delay: how much later than scheduled the send
+// actually happened, i.e. how far workers are falling behind the target
+// rate.
+type rateLimiter struct {
+	distribution string
+	targetRate   float64 // points/sec
+	start        time.Time
+	rng          *rand.Rand
+
+	mu        sync.Mutex
+	scheduled time.Time // next scheduled send time
+}
+
+func newRateLimiter(targetRate float64, distribution string) *rateLimiter {
+	if targetRate <= 0 {
+		return nil
+	}
+	return &rateLimiter{
+		distribution: distribution,
+		targetRate:   targetRate,
+		start:        time.Now(),
+		rng:          rand.New(rand.NewSource(1)),
+	}
+}
+
+// nextInterval returns the wall-clock gap before the next batch of n points
+// should be released, under the configured distribution.
+func (rl *rateLimiter) nextInterval(n int) time.Duration {
+	mean := float64(n) / rl.targetRate
+	switch rl.distribution {
+	case rateDistributionPoisson:
+		// Inter-arrival times of a Poisson process are exponentially
+		// distributed with the same mean.
+		u := rl.rng.Float64()
+		if u == 0 {
+			u = 1e-9
+		}
+		return time.Duration(-mean * math.Log(u) * float64(time.Second))
+	case rateDistributionStep:
+		// Double the rate (halve the interval) every 30s, up to 8x, then
+		// hold, approximating a step-load test.
+		steps := int64(time.Since(rl.start) / (30 * time.Second))
+		if steps > 3 {
+			steps = 3
+		}
+		factor := math.Pow(2, float64(steps))
+		return time.Duration(mean / factor * float64(time.Second))
+	case rateDistributionRamp:
+		// Linearly ramp from 10% to 100% of the target rate over 5 minutes.
+		frac := 0.1 + 0.9*math.Min(1, time.Since(rl.start).Seconds()/(5*60))
+		return time.Duration(mean / frac * float64(time.Second))
+	default: // rateDistributionConstant
+		return time.Duration(mean * float64(time.Second))
+	}
+}
+
+// Wait blocks until the next batch of n points is scheduled to be released
+// and returns how much later than scheduled the caller actually sent it.
+func (rl *rateLimiter) Wait(n int) time.Duration {
+	rl.mu.Lock()
+	if rl.scheduled.IsZero() {
+		rl.scheduled = time.Now()
+	}
+	scheduled := rl.scheduled
+	rl.scheduled = rl.scheduled.Add(rl.nextInterval(n))
+	rl.mu.Unlock()
+
+	if d := time.Until(scheduled); d > 0 {
+		time.Sleep(d)
+	}
+	return time.Since(scheduled)
+}
+
+// queueDelayStats accumulates rateLimiter queueing-delay samples between
+// reporting periods, so report can print the mean delay for each window
+// without unbounded memory growth.
+type queueDelayStats struct {
+	sumNs int64
+	count int64
+}
+
+func (s *queueDelayStats) add(d time.Duration) {
+	atomic.AddInt64(&s.sumNs, int64(d))
+	atomic.AddInt64(&s.count, 1)
+}
+
+// meanAndReset returns the mean delay recorded since the last call and
+// clears the accumulators for the next period.
+func (s *queueDelayStats) meanAndReset() time.Duration {
+	sum := atomic.SwapInt64(&s.sumNs, 0)
+	count := atomic.SwapInt64(&s.count, 0)
+	if count == 0 {
+		return 0
+	}
+	return time.Duration(sum / count)
+}
+
 // Benchmark is an interface that represents the skeleton of a program
 // needed to run an insert or load benchmark.
 type Benchmark interface {
@@ -38,17 +447,42 @@ type Benchmark interface {
 // BenchmarkRunner is responsible for initializing and storing common
 // flags across all database systems and ultimately running a supplied Benchmark
 type BenchmarkRunner struct {
-	dbName          string
-	batchSize       int
-	workers         uint
-	limit           int64
-	doLoad          bool
-	doInit          bool
-	reportingPeriod time.Duration
-	filename        string // TODO implement file reading
+	dbName            string
+	batchSize         batchSizeFlag
+	adaptiveBatching  bool
+	workers           uint
+	limit             int64
+	doLoad            bool
+	doInit            bool
+	reportingPeriod   time.Duration
+	runtime           durationOrCountFlag
+	steadyStateWindow int
+	resultFormat      string
+	resultFile        string
+	benchmem          bool
+	files             stringSliceFlag
+	fileGlob          string
+	readSize          int
+	mmap              bool
+	targetRate        float64
+	rateDistribution  string
+	cpuProfile        string
+	memProfile        string
+	mutexProfile      string
+	blockProfile      string
+	traceFile         string
+	memProfileRate    int
+	pprofAddr         string
 
 	// non-flag fields
-	br *bufio.Reader
+	brs               []*bufio.Reader
+	periods           []periodRecord
+	periodsMu         sync.Mutex
+	resW              io.Writer
+	queueDelay        *queueDelayStats
+	batchSizeProvider *batchSizeProvider
+	latencyCh         chan time.Duration
+	scanBudget        *scanBudget
 }
 
 var loader = &BenchmarkRunner{}
@@ -64,12 +498,32 @@ func GetBenchmarkRunner() *BenchmarkRunner {
 func GetBenchmarkRunnerWithBatchSize(batchSize int) *BenchmarkRunner {
 	flag.StringVar(&loader.dbName, "db-name", "benchmark", "Name of database")
 
-	flag.IntVar(&loader.batchSize, "batch-size", batchSize, "Number of items to batch together in a single insert")
+	loader.batchSize = batchSizeFlag{n: batchSize}
+	flag.Var(&loader.batchSize, "batch-size", fmt.Sprintf("Number of items to batch together in a single insert, or \"auto\" to adapt the batch size to keep median ProcessBatch latency between %s and %s", batchLatencyLow, batchLatencyHigh))
+	flag.BoolVar(&loader.adaptiveBatching, "adaptive-batching", false, "Equivalent to -batch-size=auto")
 	flag.UintVar(&loader.workers, "workers", 1, "Number of parallel clients inserting")
 	flag.Int64Var(&loader.limit, "limit", -1, "Number of items to insert (default unlimited).")
 	flag.BoolVar(&loader.doLoad, "do-load", true, "Whether to write data. Set this flag to false to check input read speed")
 	flag.BoolVar(&loader.doInit, "do-init", true, "Whether to initialize the database. Disable on all but one box if running on a multi client box setup.")
 	flag.DurationVar(&loader.reportingPeriod, "reporting-period", 10*time.Second, "Period to report write stats")
+	flag.Var(&loader.runtime, "runtime", "Stop after this duration (e.g. 30s, 5m) or point count (e.g. 1000000x), as with the testing package's -benchtime. A count overrides -limit; a duration stops the run independent of -limit.")
+	flag.IntVar(&loader.steadyStateWindow, "steady-state-window", 0, "Number of trailing reporting periods whose rates must converge (coefficient of variation below 2%) before stopping; 0 disables steady-state detection")
+	flag.StringVar(&loader.resultFormat, "result-format", resultFormatText, "Result output format: text, json, or go-bench")
+	flag.StringVar(&loader.resultFile, "result-file", "", "Write results to this file instead of stdout (used by -result-format json and go-bench)")
+	flag.BoolVar(&loader.benchmem, "benchmem", false, "Capture runtime.MemStats deltas around the run and include them in -result-format go-bench/json output")
+	flag.Var(&loader.files, "file", "Path to an input data file (repeatable); gzip/zstd/bzip2 are auto-detected by extension or magic bytes. Defaults to stdin if neither -file nor -file-glob is given.")
+	flag.StringVar(&loader.fileGlob, "file-glob", "", "Glob pattern matching input data files, combined with any -file flags")
+	flag.IntVar(&loader.readSize, "read-size", defaultReadSize, "Size in bytes of each input file's read buffer")
+	flag.BoolVar(&loader.mmap, "mmap", false, "Memory-map local input files instead of reading them through a buffered Reader")
+	flag.Float64Var(&loader.targetRate, "target-rate", 0, "Target open-loop load rate in points/sec (0 disables rate limiting, the default: batches are released as fast as workers drain them)")
+	flag.StringVar(&loader.rateDistribution, "rate-distribution", rateDistributionConstant, "Inter-batch scheduling distribution for -target-rate: constant, poisson, step, or ramp")
+	flag.StringVar(&loader.cpuProfile, "cpuprofile", "", "Write a CPU profile to this file")
+	flag.StringVar(&loader.memProfile, "memprofile", "", "Write a heap profile to this file after the run finishes")
+	flag.StringVar(&loader.mutexProfile, "mutexprofile", "", "Write a mutex contention profile to this file after the run finishes")
+	flag.StringVar(&loader.blockProfile, "blockprofile", "", "Write a goroutine blocking profile to this file after the run finishes")
+	flag.StringVar(&loader.traceFile, "trace", "", "Write an execution trace to this file")
+	flag.IntVar(&loader.memProfileRate, "memprofile-rate", 0, "Set runtime.MemProfileRate (0 leaves the runtime default unchanged)")
+	flag.StringVar(&loader.pprofAddr, "pprof-addr", "", "Address to serve net/http/pprof on for live inspection during the run (e.g. localhost:6060)")
 
 	return loader
 }
@@ -92,7 +546,9 @@ func (l *BenchmarkRunner) DoInit() bool {
 // RunBenchmark takes in a Benchmark b, a bufio.Reader br, and holders for number of metrics and rows
 // and uses those to run the load benchmark
 func (l *BenchmarkRunner) RunBenchmark(b Benchmark, workQueues uint, metricCount, rowCount *uint64) {
-	l.br = l.GetBufferedReader()
+	if _, err := l.GetBufferedReaders(); err != nil {
+		panic(fmt.Sprintf("could not open input: %v", err))
+	}
 	var wg sync.WaitGroup
 
 	channels := []*duplexChannel{}
@@ -107,13 +563,82 @@ func (l *BenchmarkRunner) RunBenchmark(b Benchmark, workQueues uint, metricCount
 		channels = append(channels, newDuplexChannel(perQueue))
 	}
 
+	stopProfiling := l.startProfiling()
+
+	initialBatchSize := l.batchSize.n
+	if l.isAdaptiveBatching() {
+		// -adaptive-batching may be set without -batch-size=auto, in which
+		// case batchSize.n still holds -batch-size's own value (default or
+		// user-supplied). Adaptive batching always starts small regardless
+		// of which flag enabled it.
+		initialBatchSize = adaptiveInitialBatchSize
+		l.latencyCh = make(chan time.Duration, 4*int(l.workers))
+	}
+	l.batchSizeProvider = newBatchSizeProvider(initialBatchSize)
+
 	for i := 0; i < int(l.workers); i++ {
 		wg.Add(1)
-		go work(b, &wg, channels[i%len(channels)], i, l.doLoad)
+		go work(b, &wg, channels[i%len(channels)], i, l.doLoad, l.latencyCh)
+	}
+
+	// An explicit point count (e.g. -runtime 1000000x) is just an alternate
+	// spelling of -limit.
+	if l.runtime.n > 0 {
+		l.limit = l.runtime.n
+	}
+
+	var deadlineC <-chan time.Time
+	if l.runtime.d > 0 {
+		deadlineC = time.After(l.runtime.d)
+	}
+
+	steadyC := make(chan struct{})
+	stop := make(chan struct{})
+
+	if l.resultFormat != resultFormatText {
+		w, closeFn, err := l.openResultWriter()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not open -result-file %q: %v\n", l.resultFile, err)
+		} else {
+			l.resW = w
+			defer closeFn()
+		}
+	}
+
+	var memBefore, memAfter runtime.MemStats
+	if l.benchmem {
+		runtime.GC()
+		runtime.ReadMemStats(&memBefore)
 	}
 
 	start := time.Now()
-	l.scan(b, channels, maxPartitions, metricCount, rowCount)
+	scanDone := make(chan struct{})
+	go func() {
+		l.scan(b, channels, maxPartitions, metricCount, rowCount, stop, steadyC)
+		close(scanDone)
+	}()
+
+	var reason terminationReason
+	select {
+	case <-scanDone:
+		// l.limit is -1 (unlimited) unless -limit or a count-form -runtime
+		// (e.g. 1000000x) was configured; even then, scanDone can fire
+		// because the input simply ran out before the budget was spent.
+		// Only report terminationLimit when the budget was actually
+		// exhausted.
+		reason = terminationInputExhausted
+		if l.limit >= 0 && l.scanBudget != nil && atomic.LoadInt64(&l.scanBudget.remaining) <= 0 {
+			reason = terminationLimit
+		}
+	case <-deadlineC:
+		reason = terminationDeadline
+		close(stop)
+		<-scanDone
+	case <-steadyC:
+		reason = terminationSteadyState
+		close(stop)
+		<-scanDone
+	}
 
 	for _, c := range channels {
 		c.close()
@@ -121,36 +646,494 @@ func (l *BenchmarkRunner) RunBenchmark(b Benchmark, workQueues uint, metricCount
 	wg.Wait()
 	end := time.Now()
 
-	summary(end.Sub(start), l.workers, metricCount, rowCount)
+	if l.latencyCh != nil {
+		close(l.latencyCh)
+	}
+
+	stopProfiling()
+
+	var mem *memStatsDelta
+	if l.benchmem {
+		runtime.ReadMemStats(&memAfter)
+		mem = &memStatsDelta{
+			AllocBytes:      memAfter.Alloc,
+			TotalAllocBytes: memAfter.TotalAlloc - memBefore.TotalAlloc,
+			Mallocs:         memAfter.Mallocs - memBefore.Mallocs,
+			Frees:           memAfter.Frees - memBefore.Frees,
+			NumGC:           memAfter.NumGC - memBefore.NumGC,
+		}
+	}
+
+	l.summary(end.Sub(start), metricCount, rowCount, reason, mem)
 }
 
-// GetBufferedReader returns the buffered Reader that should be used by the loader
-func (l *BenchmarkRunner) GetBufferedReader() *bufio.Reader {
-	if l.br == nil {
-		if len(l.filename) > 0 {
-			l.br = nil // TODO - Support reading from files
+// openResultWriter returns the writer that -result-format json/go-bench
+// output should be written to: the file named by -result-file, or
+// os.Stdout if that flag is unset. The returned func must be called once
+// the writer is no longer needed.
+func (l *BenchmarkRunner) openResultWriter() (io.Writer, func(), error) {
+	if l.resultFile == "" {
+		return os.Stdout, func() {}, nil
+	}
+	f, err := os.Create(l.resultFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, func() { f.Close() }, nil
+}
+
+// startProfiling applies -memprofile-rate and -pprof-addr, opens the files
+// requested by -cpuprofile and -trace, and begins capturing them. It
+// returns a stop function that must be called once workers have finished,
+// which ends CPU/trace capture and writes the -memprofile, -mutexprofile,
+// and -blockprofile files.
+func (l *BenchmarkRunner) startProfiling() func() {
+	if l.memProfileRate > 0 {
+		runtime.MemProfileRate = l.memProfileRate
+	}
+	if l.mutexProfile != "" {
+		runtime.SetMutexProfileFraction(1)
+	}
+	if l.blockProfile != "" {
+		runtime.SetBlockProfileRate(1)
+	}
+	if l.pprofAddr != "" {
+		go func() {
+			if err := http.ListenAndServe(l.pprofAddr, nil); err != nil {
+				fmt.Fprintf(os.Stderr, "pprof server on %s exited: %v\n", l.pprofAddr, err)
+			}
+		}()
+	}
+
+	var cpuFile, traceFile *os.File
+	if l.cpuProfile != "" {
+		f, err := os.Create(l.cpuProfile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not create -cpuprofile %q: %v\n", l.cpuProfile, err)
+		} else if err := pprof.StartCPUProfile(f); err != nil {
+			fmt.Fprintf(os.Stderr, "could not start cpu profile: %v\n", err)
+			f.Close()
+		} else {
+			cpuFile = f
+		}
+	}
+	if l.traceFile != "" {
+		f, err := os.Create(l.traceFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not create -trace %q: %v\n", l.traceFile, err)
+		} else if err := trace.Start(f); err != nil {
+			fmt.Fprintf(os.Stderr, "could not start trace: %v\n", err)
+			f.Close()
 		} else {
-			l.br = bufio.NewReaderSize(os.Stdin, defaultReadSize)
+			traceFile = f
+		}
+	}
+
+	return func() {
+		if cpuFile != nil {
+			pprof.StopCPUProfile()
+			cpuFile.Close()
+		}
+		if traceFile != nil {
+			trace.Stop()
+			traceFile.Close()
+		}
+		l.writeLookupProfile(l.mutexProfile, "mutex")
+		l.writeLookupProfile(l.blockProfile, "block")
+		if l.memProfile != "" {
+			l.writeMemProfile()
+		}
+	}
+}
+
+// writeLookupProfile writes the named runtime/pprof profile (e.g. "mutex",
+// "block") to path, if path is set.
+func (l *BenchmarkRunner) writeLookupProfile(path, name string) {
+	if path == "" {
+		return
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not create %s profile %q: %v\n", name, path, err)
+		return
+	}
+	defer f.Close()
+	if err := pprof.Lookup(name).WriteTo(f, 0); err != nil {
+		fmt.Fprintf(os.Stderr, "could not write %s profile: %v\n", name, err)
+	}
+}
+
+// writeMemProfile writes a heap profile to -memprofile after a forced GC,
+// so it reflects live heap usage at the end of the run.
+func (l *BenchmarkRunner) writeMemProfile() {
+	f, err := os.Create(l.memProfile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not create -memprofile %q: %v\n", l.memProfile, err)
+		return
+	}
+	defer f.Close()
+	runtime.GC()
+	if err := pprof.WriteHeapProfile(f); err != nil {
+		fmt.Fprintf(os.Stderr, "could not write heap profile: %v\n", err)
+	}
+}
+
+// GetBufferedReader returns the buffered Reader that should be used by the
+// loader. For multi-file input, prefer GetBufferedReaders; this returns the
+// first of whatever it resolves (a single -file, the first glob match, or
+// stdin if neither is given).
+func (l *BenchmarkRunner) GetBufferedReader() *bufio.Reader {
+	brs, err := l.GetBufferedReaders()
+	if err != nil {
+		panic(fmt.Sprintf("could not open input: %v", err))
+	}
+	return brs[0]
+}
+
+// GetBufferedReaders resolves -file and -file-glob into one buffered Reader
+// per input file, auto-detecting gzip/zstd/bzip2 compression. If neither
+// flag is set, it returns a single reader over stdin. The result is cached:
+// files are only opened once per BenchmarkRunner.
+func (l *BenchmarkRunner) GetBufferedReaders() ([]*bufio.Reader, error) {
+	if l.brs != nil {
+		return l.brs, nil
+	}
+
+	paths, err := l.inputFiles()
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		l.brs = []*bufio.Reader{bufio.NewReaderSize(os.Stdin, l.readSize)}
+		return l.brs, nil
+	}
+
+	brs := make([]*bufio.Reader, 0, len(paths))
+	for _, path := range paths {
+		r, rawMmap, err := l.openInputFile(path)
+		if err != nil {
+			return nil, err
+		}
+		bufSize := l.readSize
+		if rawMmap {
+			bufSize = mmapSniffBufferSize
+		}
+		brs = append(brs, bufio.NewReaderSize(r, bufSize))
+	}
+	l.brs = brs
+	return l.brs, nil
+}
+
+// inputFiles resolves the -file and -file-glob flags into a deduplicated,
+// sorted list of file paths.
+func (l *BenchmarkRunner) inputFiles() ([]string, error) {
+	seen := make(map[string]bool)
+	var paths []string
+	add := func(p string) {
+		if !seen[p] {
+			seen[p] = true
+			paths = append(paths, p)
+		}
+	}
+
+	for _, p := range l.files {
+		add(p)
+	}
+	if l.fileGlob != "" {
+		matches, err := filepath.Glob(l.fileGlob)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -file-glob %q: %v", l.fileGlob, err)
+		}
+		for _, m := range matches {
+			add(m)
+		}
+	}
+
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// mmapSniffBufferSize is the bufio.Reader buffer size GetBufferedReaders
+// uses over a raw (uncompressed) mmap'd reader, in place of -read-size.
+// io.SectionReader.Read already reads directly out of mapped pages with no
+// read() syscall, so unlike a regular file there's no I/O-batching benefit
+// to sizing this buffer by -read-size; doing so would only add a second,
+// needless memory copy on top of the mapped access -read-size was supposed
+// to help -mmap bypass.
+const mmapSniffBufferSize = 512
+
+// openInputFile opens path and wraps it in a decompressing reader if its
+// extension or leading magic bytes indicate gzip, zstd, or bzip2 content.
+// When -mmap is set, the file is memory-mapped instead of opened as a
+// regular *os.File. rawMmap reports whether the returned reader is that
+// mmap'd section with no decompression layer in front of it, so callers can
+// avoid re-introducing a large bufio copy on top of the mapped memory.
+//
+// Magic bytes are sniffed by reading directly off the opened file (or mmap
+// section) and seeking back to the start, rather than through a small
+// fixed-size bufio.Reader: the uncompressed path returns the raw reader
+// as-is, so GetBufferedReaders' own buffering wrap is the only buffering
+// layer and -read-size actually controls read size for plain files.
+func (l *BenchmarkRunner) openInputFile(path string) (r io.Reader, rawMmap bool, err error) {
+	if l.mmap {
+		rd, err := mmap.Open(path)
+		if err != nil {
+			return nil, false, fmt.Errorf("could not mmap %q: %v", path, err)
+		}
+		r = io.NewSectionReader(rd, 0, int64(rd.Len()))
+	} else {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, false, fmt.Errorf("could not open %q: %v", path, err)
+		}
+		r = f
+	}
+
+	seeker, ok := r.(io.Seeker)
+	if !ok {
+		return nil, false, fmt.Errorf("could not sniff %q: input does not support seeking", path)
+	}
+	magic := make([]byte, 4)
+	n, err := io.ReadFull(r, magic)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, false, fmt.Errorf("could not sniff %q: %v", path, err)
+	}
+	magic = magic[:n]
+	if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+		return nil, false, fmt.Errorf("could not rewind %q after sniffing: %v", path, err)
+	}
+
+	switch {
+	case strings.HasSuffix(path, ".gz") || isGzipMagic(magic):
+		gr, err := gzip.NewReader(bufio.NewReaderSize(r, l.readSize))
+		return gr, false, err
+	case strings.HasSuffix(path, ".zst") || isZstdMagic(magic):
+		zr, err := zstd.NewReader(bufio.NewReaderSize(r, l.readSize))
+		if err != nil {
+			return nil, false, fmt.Errorf("could not open zstd stream in %q: %v", path, err)
+		}
+		return zr.IOReadCloser(), false, nil
+	case strings.HasSuffix(path, ".bz2") || isBzip2Magic(magic):
+		return bzip2.NewReader(bufio.NewReaderSize(r, l.readSize)), false, nil
+	default:
+		return r, l.mmap, nil
+	}
+}
+
+func isGzipMagic(b []byte) bool { return len(b) >= 2 && b[0] == 0x1f && b[1] == 0x8b }
+func isZstdMagic(b []byte) bool {
+	return len(b) >= 4 && b[0] == 0x28 && b[1] == 0xb5 && b[2] == 0x2f && b[3] == 0xfd
+}
+func isBzip2Magic(b []byte) bool { return len(b) >= 3 && b[0] == 'B' && b[1] == 'Z' && b[2] == 'h' }
+
+// scanBudget is a -limit cap shared across every per-file scanner goroutine
+// scanFiles spawns, so a negative (unlimited) or positive limit applies to
+// the aggregate point count across all input files rather than to each file
+// independently.
+type scanBudget struct {
+	remaining int64
+}
+
+func newScanBudget(limit int64) *scanBudget {
+	return &scanBudget{remaining: limit}
+}
+
+// take reserves up to n points against the budget and returns how many of
+// them are actually allowed. A negative limit means unlimited and always
+// allows the full request.
+func (s *scanBudget) take(n int64) int64 {
+	for {
+		remaining := atomic.LoadInt64(&s.remaining)
+		if remaining < 0 {
+			return n
+		}
+		if remaining == 0 {
+			return 0
+		}
+		allowed := n
+		if allowed > remaining {
+			allowed = remaining
+		}
+		if atomic.CompareAndSwapInt64(&s.remaining, remaining, remaining-allowed) {
+			return allowed
 		}
 	}
-	return l.br
 }
 
 // scan launches any needed reporting mechanism and proceeds to scan input data
-// to distribute to workers
-func (l *BenchmarkRunner) scan(b Benchmark, channels []*duplexChannel, maxPartitions uint, metricCount, rowCount *uint64) int64 {
+// to distribute to workers. stop, when closed, tells the underlying scan to
+// wind down early (deadline or steady-state termination); steadyC is closed
+// by the steady-state watcher, if any, once the rolling rate has converged.
+// When multiple input files were resolved, one scanner goroutine per file
+// feeds the shared channels, so decoding isn't bottlenecked on a single
+// bufio.Reader.
+func (l *BenchmarkRunner) scan(b Benchmark, channels []*duplexChannel, maxPartitions uint, metricCount, rowCount *uint64, stop <-chan struct{}, steadyC chan<- struct{}) int64 {
+	var rateCh chan float64
+	if l.steadyStateWindow > 0 {
+		rateCh = make(chan float64)
+		go l.watchSteadyState(rateCh, steadyC)
+	}
+
+	limiter := newRateLimiter(l.targetRate, l.rateDistribution)
+	var delay *queueDelayStats
+	if limiter != nil {
+		delay = &queueDelayStats{}
+	}
+	l.queueDelay = delay
+
+	if l.isAdaptiveBatching() {
+		go l.adjustBatchSize(l.batchSizeProvider, l.latencyCh)
+	}
+
 	if l.reportingPeriod.Nanoseconds() > 0 {
-		go report(l.reportingPeriod, metricCount, rowCount)
+		go l.report(l.reportingPeriod, metricCount, rowCount, rateCh)
+	}
+
+	budget := newScanBudget(l.limit)
+	l.scanBudget = budget
+
+	// scanFiles distributes decoding across files by feeding the same
+	// channels/indexer from multiple goroutines; it doesn't depend on how
+	// workQueues maps to channels, so it applies for any workQueues value
+	// whenever more than one input file was resolved.
+	if len(l.brs) > 1 {
+		return l.scanFiles(b, channels, maxPartitions, stop, limiter, delay, budget)
+	}
+
+	br := l.brs[0]
+	return scanWithIndexer(channels, l.batchSizeProvider, budget, br, b.GetPointDecoder(br), b.GetBatchFactory(), b.GetPointIndexer(maxPartitions), stop, limiter, delay)
+}
+
+// scanFiles launches one scanner goroutine per resolved input file, each
+// decoding through its own PointDecoder but sharing a single PointIndexer so
+// points land in the same per-partition channels regardless of which file
+// produced them. budget is shared across all of them so -limit caps the
+// aggregate point count across files, not each file independently.
+func (l *BenchmarkRunner) scanFiles(b Benchmark, channels []*duplexChannel, maxPartitions uint, stop <-chan struct{}, limiter *rateLimiter, delay *queueDelayStats, budget *scanBudget) int64 {
+	indexer := b.GetPointIndexer(maxPartitions)
+	factory := b.GetBatchFactory()
+
+	var wg sync.WaitGroup
+	var total int64
+	var mu sync.Mutex
+	for _, br := range l.brs {
+		wg.Add(1)
+		go func(br *bufio.Reader) {
+			defer wg.Done()
+			n := scanWithIndexer(channels, l.batchSizeProvider, budget, br, b.GetPointDecoder(br), factory, indexer, stop, limiter, delay)
+			mu.Lock()
+			total += n
+			mu.Unlock()
+		}(br)
+	}
+	wg.Wait()
+	return total
+}
+
+// isAdaptiveBatching reports whether -batch-size=auto or -adaptive-batching
+// was given.
+func (l *BenchmarkRunner) isAdaptiveBatching() bool {
+	return l.batchSize.auto || l.adaptiveBatching
+}
+
+// adjustBatchSize runs for the life of the scan when adaptive batching is
+// enabled. Each adjustment period, it computes the median ProcessBatch
+// latency observed since the last adjustment and retargets provider
+// accordingly via adjustedBatchSize. It falls back to
+// adaptiveBatchSizeDefaultPeriod when -reporting-period is unset, since
+// time.NewTicker panics on a non-positive duration.
+func (l *BenchmarkRunner) adjustBatchSize(provider *batchSizeProvider, latencyCh <-chan time.Duration) {
+	period := l.reportingPeriod
+	if period <= 0 {
+		period = adaptiveBatchSizeDefaultPeriod
+	}
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	var samples []time.Duration
+	for {
+		select {
+		case d, ok := <-latencyCh:
+			if !ok {
+				return
+			}
+			samples = append(samples, d)
+		case <-ticker.C:
+			if len(samples) == 0 {
+				continue
+			}
+			sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+			median := samples[len(samples)/2]
+			provider.set(adjustedBatchSize(provider.Get(), median))
+			samples = samples[:0]
+		}
 	}
-	return scanWithIndexer(channels, l.batchSize, l.limit, l.br, b.GetPointDecoder(l.br), b.GetBatchFactory(), b.GetPointIndexer(maxPartitions))
 }
 
-// work is the processing function for each worker in the loader
-func work(b Benchmark, wg *sync.WaitGroup, c *duplexChannel, workerNum int, doLoad bool) {
+// watchSteadyState consumes the per-period metric rates published by
+// report and closes steadyC once the coefficient of variation of the last
+// steadyStateWindow rates drops below steadyStateThreshold, indicating that
+// throughput has reached steady state.
+func (l *BenchmarkRunner) watchSteadyState(rateCh <-chan float64, steadyC chan<- struct{}) {
+	window := make([]float64, 0, l.steadyStateWindow)
+	for rate := range rateCh {
+		if len(window) == l.steadyStateWindow {
+			window = window[1:]
+		}
+		window = append(window, rate)
+		if len(window) < l.steadyStateWindow {
+			continue
+		}
+
+		if cv, ok := coefficientOfVariation(window); ok && cv < steadyStateThreshold {
+			close(steadyC)
+			return
+		}
+	}
+}
+
+// coefficientOfVariation returns the stddev/mean of samples and true, or
+// (0, false) if samples is empty or its mean is zero (where the ratio is
+// undefined).
+func coefficientOfVariation(samples []float64) (float64, bool) {
+	if len(samples) == 0 {
+		return 0, false
+	}
+
+	var sum float64
+	for _, s := range samples {
+		sum += s
+	}
+	mean := sum / float64(len(samples))
+	if mean == 0 {
+		return 0, false
+	}
+
+	var variance float64
+	for _, s := range samples {
+		variance += (s - mean) * (s - mean)
+	}
+	variance /= float64(len(samples))
+
+	return math.Sqrt(variance) / mean, true
+}
+
+// work is the processing function for each worker in the loader. When
+// latencyCh is non-nil (adaptive batching is enabled), each batch's
+// ProcessBatch wall time is fed back to adjustBatchSize on a best-effort
+// basis, so a full channel never stalls a worker.
+func work(b Benchmark, wg *sync.WaitGroup, c *duplexChannel, workerNum int, doLoad bool, latencyCh chan<- time.Duration) {
 	proc := b.GetProcessor()
 	proc.Init(workerNum, doLoad)
 	for b := range c.toWorker {
+		start := time.Now()
 		proc.ProcessBatch(b, doLoad)
+		if latencyCh != nil {
+			select {
+			case latencyCh <- time.Since(start):
+			default:
+			}
+		}
 		c.sendToScanner()
 	}
 	wg.Done()
@@ -160,26 +1143,112 @@ func work(b Benchmark, wg *sync.WaitGroup, c *duplexChannel, workerNum int, doLo
 	}
 }
 
-// summary prints the summary of statistics from loading
-func summary(took time.Duration, workers uint, metricCount, rowCount *uint64) {
-	metricRate := float64(*metricCount) / float64(took.Seconds())
-	fmt.Println("\nSummary:")
-	fmt.Printf("loaded %d metrics in %0.3fsec with %d workers (mean rate %0.2f metrics/sec)\n", *metricCount, took.Seconds(), workers, metricRate)
+// summary renders the final results of loading, in the format selected by
+// -result-format: human-readable text to stdout, or a json/go-bench record
+// to -result-file (or stdout, if that flag is unset).
+func (l *BenchmarkRunner) summary(took time.Duration, metricCount, rowCount *uint64, reason terminationReason, mem *memStatsDelta) {
+	mc := *metricCount
+	var rc uint64
 	if rowCount != nil {
-		rowRate := float64(*rowCount) / float64(took.Seconds())
-		fmt.Printf("loaded %d rows in %0.3fsec with %d workers (mean rate %0.2f rows/sec)\n", *rowCount, took.Seconds(), workers, rowRate)
+		rc = *rowCount
 	}
+	metricRate := float64(mc) / took.Seconds()
+	var rowRate float64
+	if rowCount != nil {
+		rowRate = float64(rc) / took.Seconds()
+	}
+
+	l.periodsMu.Lock()
+	periods := append([]periodRecord(nil), l.periods...)
+	l.periodsMu.Unlock()
+
+	var meanQueueDelayMs float64
+	if l.queueDelay != nil && len(periods) > 0 {
+		var sum float64
+		for _, p := range periods {
+			sum += p.QueueDelayMs
+		}
+		meanQueueDelayMs = sum / float64(len(periods))
+	}
+
+	if l.resultFormat != resultFormatJSON && l.resultFormat != resultFormatGoBench {
+		fmt.Println("\nSummary:")
+		fmt.Printf("loaded %d metrics in %0.3fsec with %d workers (mean rate %0.2f metrics/sec)\n", mc, took.Seconds(), l.workers, metricRate)
+		if rowCount != nil {
+			fmt.Printf("loaded %d rows in %0.3fsec with %d workers (mean rate %0.2f rows/sec)\n", rc, took.Seconds(), l.workers, rowRate)
+		}
+		if l.queueDelay != nil {
+			fmt.Printf("mean queueing delay %0.3fms (target rate %0.2f points/sec, %s)\n", meanQueueDelayMs, l.targetRate, l.rateDistribution)
+		}
+		if l.isAdaptiveBatching() {
+			fmt.Printf("final adaptive batch size: %d\n", l.batchSizeProvider.Get())
+		}
+		fmt.Printf("terminated by: %s\n", reason)
+		return
+	}
+
+	if l.resW == nil {
+		return
+	}
+
+	rates := make([]float64, len(periods))
+	for i, p := range periods {
+		rates[i] = p.MetricRate
+	}
+	sort.Float64s(rates)
+
+	res := resultSummary{
+		DBName:       l.dbName,
+		Workers:      l.workers,
+		BatchSize:    l.batchSizeProvider.Get(),
+		MetricCount:  mc,
+		RowCount:     rc,
+		TookSeconds:  took.Seconds(),
+		MetricRate:   metricRate,
+		RowRate:      rowRate,
+		RateP50:      percentile(rates, 0.50),
+		RateP95:      percentile(rates, 0.95),
+		RateP99:      percentile(rates, 0.99),
+		TerminatedBy: reason.String(),
+		QueueDelayMs: meanQueueDelayMs,
+		MemStats:     mem,
+	}
+
+	if l.resultFormat == resultFormatJSON {
+		res.Periods = periods
+		enc := json.NewEncoder(l.resW)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(res); err != nil {
+			fmt.Fprintf(os.Stderr, "could not write json result: %v\n", err)
+		}
+		return
+	}
+
+	fmt.Fprintln(l.resW, goBenchLine(res))
 }
 
-// report handles periodic reporting of loading stats
-func report(period time.Duration, metricCount, rowCount *uint64) {
+// report handles periodic reporting of loading stats. If rateCh is non-nil,
+// the metric rate for each period is also published to it for
+// steady-state detection. Each period's rate is retained for the final
+// summary's percentiles and, when -result-format=json, is also written to
+// -result-file as its own JSON record.
+func (l *BenchmarkRunner) report(period time.Duration, metricCount, rowCount *uint64, rateCh chan<- float64) {
 	start := time.Now()
 	prevTime := start
 	prevColCount := uint64(0)
 	prevRowCount := uint64(0)
 
 	rCount := uint64(0)
-	fmt.Printf("time,per. metric/s,metric total,overall metric/s,per. row/s,row total,overall row/s\n")
+	if l.resultFormat == resultFormatText {
+		header := "time,per. metric/s,metric total,overall metric/s,per. row/s,row total,overall row/s"
+		if l.queueDelay != nil {
+			header += ",queue delay(ms)"
+		}
+		if l.isAdaptiveBatching() {
+			header += ",batch size"
+		}
+		fmt.Println(header)
+	}
 	for now := range time.NewTicker(period).C {
 		cCount := atomic.LoadUint64(metricCount)
 		if rowCount != nil {
@@ -190,16 +1259,58 @@ func report(period time.Duration, metricCount, rowCount *uint64) {
 		took := now.Sub(prevTime)
 		colrate := float64(cCount-prevColCount) / float64(took.Seconds())
 		overallColRate := float64(cCount) / float64(sinceStart.Seconds())
+		rec := periodRecord{
+			Time:              now.Unix(),
+			MetricRate:        colrate,
+			MetricTotal:       cCount,
+			OverallMetricRate: overallColRate,
+		}
 		if rowCount != nil {
-			rowrate := float64(rCount-prevRowCount) / float64(took.Seconds())
-			overallRowRate := float64(rCount) / float64(sinceStart.Seconds())
-			fmt.Printf("%d,%0.3f,%E,%0.3f,%0.3f,%E,%0.3f\n", now.Unix(), colrate, float64(cCount), overallColRate, rowrate, float64(rCount), overallRowRate)
-		} else {
-			fmt.Printf("%d,%0.3f,%E,%0.3f,-,-,-\n", now.Unix(), colrate, float64(cCount), overallColRate)
+			rec.RowRate = float64(rCount-prevRowCount) / float64(took.Seconds())
+			rec.RowTotal = rCount
+			rec.OverallRowRate = float64(rCount) / float64(sinceStart.Seconds())
+		}
+		if l.queueDelay != nil {
+			rec.QueueDelayMs = float64(l.queueDelay.meanAndReset()) / float64(time.Millisecond)
+		}
+		if l.isAdaptiveBatching() {
+			rec.BatchSize = l.batchSizeProvider.Get()
+		}
+
+		switch l.resultFormat {
+		case resultFormatJSON:
+			if l.resW != nil {
+				if err := json.NewEncoder(l.resW).Encode(rec); err != nil {
+					fmt.Fprintf(os.Stderr, "could not write json period record: %v\n", err)
+				}
+			}
+		case resultFormatGoBench:
+			// go-bench mode only emits the final summary line.
+		default:
+			if rowCount != nil {
+				fmt.Printf("%d,%0.3f,%E,%0.3f,%0.3f,%E,%0.3f", rec.Time, rec.MetricRate, float64(rec.MetricTotal), rec.OverallMetricRate, rec.RowRate, float64(rec.RowTotal), rec.OverallRowRate)
+			} else {
+				fmt.Printf("%d,%0.3f,%E,%0.3f,-,-,-", rec.Time, rec.MetricRate, float64(rec.MetricTotal), rec.OverallMetricRate)
+			}
+			if l.queueDelay != nil {
+				fmt.Printf(",%0.3f", rec.QueueDelayMs)
+			}
+			if l.isAdaptiveBatching() {
+				fmt.Printf(",%d", rec.BatchSize)
+			}
+			fmt.Println()
 		}
 
+		l.periodsMu.Lock()
+		l.periods = append(l.periods, rec)
+		l.periodsMu.Unlock()
+
 		prevColCount = cCount
 		prevRowCount = rCount
 		prevTime = now
+
+		if rateCh != nil {
+			rateCh <- colrate
+		}
 	}
 }
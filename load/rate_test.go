@@ -0,0 +1,47 @@
+package load
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQueueDelayStatsMeanAndReset(t *testing.T) {
+	var s queueDelayStats
+	s.add(100 * time.Millisecond)
+	s.add(200 * time.Millisecond)
+	s.add(300 * time.Millisecond)
+
+	if got, want := s.meanAndReset(), 200*time.Millisecond; got != want {
+		t.Errorf("meanAndReset() = %v, want %v", got, want)
+	}
+	// accumulators must be cleared for the next period.
+	if got, want := s.meanAndReset(), time.Duration(0); got != want {
+		t.Errorf("meanAndReset() after reset = %v, want %v", got, want)
+	}
+}
+
+func TestQueueDelayStatsMeanAndResetEmpty(t *testing.T) {
+	var s queueDelayStats
+	if got, want := s.meanAndReset(), time.Duration(0); got != want {
+		t.Errorf("meanAndReset() on empty stats = %v, want %v", got, want)
+	}
+}
+
+func TestRateLimiterNextIntervalConstant(t *testing.T) {
+	rl := newRateLimiter(100, rateDistributionConstant)
+	if got, want := rl.nextInterval(50), 500*time.Millisecond; got != want {
+		t.Errorf("nextInterval(50) = %v, want %v", got, want)
+	}
+	if got, want := rl.nextInterval(100), time.Second; got != want {
+		t.Errorf("nextInterval(100) = %v, want %v", got, want)
+	}
+}
+
+func TestNewRateLimiterDisabled(t *testing.T) {
+	if rl := newRateLimiter(0, rateDistributionConstant); rl != nil {
+		t.Errorf("newRateLimiter(0, ...) = %v, want nil", rl)
+	}
+	if rl := newRateLimiter(-1, rateDistributionConstant); rl != nil {
+		t.Errorf("newRateLimiter(-1, ...) = %v, want nil", rl)
+	}
+}
@@ -0,0 +1,142 @@
+package load
+
+import (
+	"bufio"
+	"sync/atomic"
+)
+
+// Point is a single decoded unit of input data, produced by a PointDecoder
+// and destined for a Batch.
+type Point interface{}
+
+// Batch accumulates Points for a single insert/write call made by a
+// Processor.
+type Batch interface {
+	// Append adds a decoded Point to the Batch.
+	Append(p Point)
+	// Len returns the number of Points currently held by the Batch.
+	Len() int
+}
+
+// BatchFactory creates empty Batches for a Benchmark's database/format.
+type BatchFactory interface {
+	// New returns a new, empty Batch.
+	New() Batch
+}
+
+// PointDecoder decodes one Point at a time from the buffered input it was
+// constructed around.
+type PointDecoder interface {
+	// Decode reads and returns the next Point from br, or nil once the
+	// input is exhausted.
+	Decode(br *bufio.Reader) Point
+}
+
+// PointIndexer assigns each decoded Point to one of a fixed number of
+// partitions, so that related points (e.g. the same series) land in the
+// same worker's channel regardless of which file or goroutine decoded them.
+type PointIndexer interface {
+	// GetIndex returns the partition index, in [0, maxPartitions), that p
+	// should be routed to.
+	GetIndex(p Point) uint
+}
+
+// Processor applies Batches to the target database or system under test.
+type Processor interface {
+	// Init prepares the Processor to run as worker number workerNum.
+	Init(workerNum int, doLoad bool)
+	// ProcessBatch writes b, if doLoad is true, and reports its own
+	// progress via whatever metric/row counters it was given at
+	// construction time.
+	ProcessBatch(b Batch, doLoad bool)
+}
+
+// ProcessorCloser is implemented by Processors that hold resources (e.g.
+// database connections) that must be released once all Batches have been
+// processed.
+type ProcessorCloser interface {
+	Processor
+	// Close releases any resources held by the Processor.
+	Close(doLoad bool)
+}
+
+// scanWithIndexer decodes Points from br via decoder, appends each to the
+// Batch selected by indexer, and hands a Batch off to its channel once it
+// reaches the current target batch size (as reported by batchSize, which
+// may change between Batches under adaptive batching). It returns the
+// number of Points decoded.
+//
+// budget caps the aggregate number of Points that may be decoded across
+// every concurrent call to scanWithIndexer sharing the same budget (see
+// scanBudget); stop, when closed, ends the scan early regardless of budget
+// or input remaining. When limiter is non-nil, each Batch send is paced
+// according to the configured -target-rate/-rate-distribution, and the
+// resulting scheduling delay is recorded in delay.
+func scanWithIndexer(
+	channels []*duplexChannel,
+	batchSize *batchSizeProvider,
+	budget *scanBudget,
+	br *bufio.Reader,
+	decoder PointDecoder,
+	factory BatchFactory,
+	indexer PointIndexer,
+	stop <-chan struct{},
+	limiter *rateLimiter,
+	delay *queueDelayStats,
+) int64 {
+	batches := make([]Batch, len(channels))
+	for i := range batches {
+		batches[i] = factory.New()
+	}
+
+	send := func(idx uint) {
+		if limiter != nil {
+			d := limiter.Wait(batches[idx].Len())
+			if delay != nil {
+				delay.add(d)
+			}
+		}
+		channels[idx].sendToWorker(batches[idx])
+		batches[idx] = factory.New()
+	}
+
+	var itemsRead int64
+scanLoop:
+	for {
+		select {
+		case <-stop:
+			break scanLoop
+		default:
+		}
+
+		if budget.take(1) == 0 {
+			break scanLoop
+		}
+
+		p := decoder.Decode(br)
+		if p == nil {
+			// Give back the unit reserved for a point that did not exist. A
+			// limited budget never goes negative and an unlimited one stays
+			// negative, so the sign tells which kind this is.
+			if atomic.LoadInt64(&budget.remaining) >= 0 {
+				atomic.AddInt64(&budget.remaining, 1)
+			}
+			break scanLoop
+		}
+		itemsRead++
+
+		idx := indexer.GetIndex(p)
+		batches[idx].Append(p)
+		if batches[idx].Len() >= batchSize.Get() {
+			send(idx)
+		}
+	}
+
+	for idx, b := range batches {
+		if b.Len() > 0 {
+			send(uint(idx))
+		}
+	}
+
+	return itemsRead
+}